@@ -0,0 +1,96 @@
+package switcherlabs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackgroundRefreshCloseStopsGoroutine(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"flags":[],"overrides":[]}`))
+	}))
+	defer srv.Close()
+
+	url := srv.URL
+	c := NewClient(&Options{APIKey: "test", URL: &url, BackgroundRefresh: true})
+
+	done := make(chan struct{})
+	go func() {
+		c.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return within 5s of stopping the background refresh goroutine")
+	}
+
+	// Close should be idempotent.
+	if err := c.Close(); err != nil {
+		t.Fatalf("second Close() returned %v, want nil", err)
+	}
+}
+
+func TestCloseWithoutBackgroundRefreshIsNoop(t *testing.T) {
+	c := NewClient(&Options{APIKey: "test"})
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close() = %v, want nil", err)
+	}
+}
+
+func TestBackgroundRefreshBacksOffOnRepeatedFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error":{"code":"boom","message":"boom"}}`))
+	}))
+	defer srv.Close()
+
+	var mu sync.Mutex
+	var gaps []time.Duration
+	var last time.Time
+	var calls int32
+
+	url := srv.URL
+	c := NewClient(&Options{
+		APIKey: "test",
+		URL:    &url,
+		OnRefreshError: func(error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			now := time.Now()
+			if !last.IsZero() {
+				gaps = append(gaps, now.Sub(last))
+			}
+			last = now
+			atomic.AddInt32(&calls, 1)
+		},
+		BackgroundRefresh: true,
+	})
+	defer c.Close()
+
+	// initialBackgroundRefreshBackoff is 1s and doubles each failure, so the
+	// gap before the 3rd failed attempt should be noticeably larger than the
+	// gap before the 2nd -- wait long enough to observe both.
+	deadline := time.Now().Add(6 * time.Second)
+	for atomic.LoadInt32(&calls) < 3 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(gaps) < 2 {
+		t.Fatalf("only observed %d failed-refresh gaps, want at least 2", len(gaps))
+	}
+	if gaps[1] <= gaps[0] {
+		t.Fatalf("backoff did not increase: gap[0]=%v, gap[1]=%v", gaps[0], gaps[1])
+	}
+}
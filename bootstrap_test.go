@@ -0,0 +1,95 @@
+package switcherlabs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestClientLoadAndWriteBootstrapFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	c := &client{BootstrapFile: path, flags: map[string]*flag{}, overrides: map[string]*override{}}
+
+	snapshot := &stateSnapshot{
+		Flags: []*flag{{ID: "f1", Key: "k1", Type: typeBoolean, Value: true}},
+	}
+	if err := c.writeBootstrapFile(snapshot); err != nil {
+		t.Fatalf("writeBootstrapFile: %v", err)
+	}
+
+	if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Fatal("expected the advisory lock file to be removed after writeBootstrapFile returns")
+	}
+
+	if err := c.loadBootstrapFile(); err != nil {
+		t.Fatalf("loadBootstrapFile: %v", err)
+	}
+
+	f, ok := c.flags["k1"]
+	if !ok || f.Value != true {
+		t.Fatalf("flags[%q] = %v, %v, want a boolean flag with Value=true", "k1", f, ok)
+	}
+}
+
+func TestLockBootstrapFileClearsStaleLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	lockPath := path + ".lock"
+
+	if err := os.WriteFile(lockPath, []byte("1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	staleTime := time.Now().Add(-2 * bootstrapLockStaleAfter)
+	if err := os.Chtimes(lockPath, staleTime, staleTime); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &client{BootstrapFile: path}
+
+	unlock, err := c.lockBootstrapFile()
+	if err != nil {
+		t.Fatalf("lockBootstrapFile should clear a stale lock and succeed, got: %v", err)
+	}
+	unlock()
+
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Fatal("expected unlock() to remove the lock file")
+	}
+}
+
+func TestLockBootstrapFileGivesUpOnFreshLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	lockPath := path + ".lock"
+
+	if err := os.WriteFile(lockPath, []byte("1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &client{BootstrapFile: path}
+
+	if _, err := c.lockBootstrapFile(); err == nil {
+		t.Fatal("expected lockBootstrapFile to fail while a fresh lock file is held")
+	}
+}
+
+func TestNewClientOfflineModeWithoutBootstrapFileRecordsError(t *testing.T) {
+	c := NewClient(&Options{APIKey: "test", OfflineMode: true})
+
+	if c.LastError() == nil {
+		t.Fatal("expected LastError to be non-nil for OfflineMode without BootstrapFile")
+	}
+}
+
+func TestNewClientOfflineModeWithBootstrapFileNoError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte(`{"flags":[],"overrides":[]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewClient(&Options{APIKey: "test", OfflineMode: true, BootstrapFile: path})
+
+	if c.LastError() != nil {
+		t.Fatalf("LastError() = %v, want nil", c.LastError())
+	}
+}
@@ -0,0 +1,73 @@
+package switcherlabs
+
+import "testing"
+
+func TestBucketOfStable(t *testing.T) {
+	// The same identifier and salt must always hash to the same bucket --
+	// across repeated calls, and within [0, bucketRangeSize).
+	got := bucketOf("alice", "s1")
+	for i := 0; i < 100; i++ {
+		if b := bucketOf("alice", "s1"); b != got {
+			t.Fatalf("bucketOf not stable: got %d, want %d", b, got)
+		}
+	}
+
+	if got < 0 || got >= bucketRangeSize {
+		t.Fatalf("bucketOf(%q, %q) = %d, out of range [0, %d)", "alice", "s1", got, bucketRangeSize)
+	}
+}
+
+func TestBucketOfDiffersBySalt(t *testing.T) {
+	// Changing the salt should (almost always) move an identifier to a
+	// different bucket -- this is how two independent bucket rules avoid
+	// correlated rollouts for the same identifier.
+	a := bucketOf("alice", "s1")
+	b := bucketOf("alice", "s2")
+	if a == b {
+		t.Fatalf("bucketOf(%q, s1) == bucketOf(%q, s2) == %d, expected different salts to differ", "alice", "alice", a)
+	}
+}
+
+func TestEvaluateBucketRuleEmptyIdentifier(t *testing.T) {
+	rule := &dynamicRule{
+		Salt:   "s1",
+		Ranges: []bucketRange{{From: 0, To: bucketRangeSize, Value: true}},
+	}
+
+	if _, ok := evaluateBucketRule(rule, ""); ok {
+		t.Fatal("evaluateBucketRule with empty identifier should fall through (ok=false)")
+	}
+}
+
+func TestEvaluateBucketRuleMatch(t *testing.T) {
+	identifier := "alice"
+	bucket := bucketOf(identifier, "s1")
+
+	rule := &dynamicRule{
+		Salt: "s1",
+		Ranges: []bucketRange{
+			{From: 0, To: bucket, Value: "before"},
+			{From: bucket, To: bucket + 1, Value: "hit"},
+			{From: bucket + 1, To: bucketRangeSize, Value: "after"},
+		},
+	}
+
+	value, ok := evaluateBucketRule(rule, identifier)
+	if !ok {
+		t.Fatal("expected evaluateBucketRule to match the range containing the identifier's bucket")
+	}
+	if value != "hit" {
+		t.Fatalf("value = %v, want %q", value, "hit")
+	}
+}
+
+func TestEvaluateBucketRuleNoMatchingRange(t *testing.T) {
+	rule := &dynamicRule{
+		Salt:   "s1",
+		Ranges: []bucketRange{{From: bucketRangeSize, To: bucketRangeSize, Value: true}},
+	}
+
+	if _, ok := evaluateBucketRule(rule, "alice"); ok {
+		t.Fatal("evaluateBucketRule with no matching range should fall through (ok=false)")
+	}
+}
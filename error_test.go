@@ -0,0 +1,62 @@
+package switcherlabs
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestResponseToErrorUsesAPIErrorShape(t *testing.T) {
+	s := &client{}
+	body := []byte(`{"error":{"code":"flag_not_found","message":"no such flag"}}`)
+
+	err := s.responseToError(&http.Response{StatusCode: 404}, body)
+
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected *apiError, got %T", err)
+	}
+	if apiErr.Code() != "flag_not_found" || apiErr.Message() != "no such flag" || apiErr.HTTPStatus() != 404 {
+		t.Fatalf("got code=%q message=%q status=%d", apiErr.Code(), apiErr.Message(), apiErr.HTTPStatus())
+	}
+	if err.Error() != "no such flag" {
+		t.Fatalf("Error() = %q, want %q", err.Error(), "no such flag")
+	}
+}
+
+func TestResponseToErrorFallsBackOnUnexpectedShape(t *testing.T) {
+	s := &client{}
+
+	for _, body := range [][]byte{[]byte("{}"), []byte(`{"status":"error"}`)} {
+		err := s.responseToError(&http.Response{StatusCode: 500}, body)
+		if err.Error() == "" {
+			t.Fatalf("Error() is blank for body %s", body)
+		}
+	}
+}
+
+func TestResponseToErrorMalformedJSON(t *testing.T) {
+	s := &client{}
+
+	err := s.responseToError(&http.Response{StatusCode: 502}, []byte("not json"))
+
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected *apiError, got %T", err)
+	}
+	if apiErr.HTTPStatus() != 502 {
+		t.Fatalf("HTTPStatus() = %d, want 502", apiErr.HTTPStatus())
+	}
+	if err.Error() == "" {
+		t.Fatal("Error() is blank for malformed JSON body")
+	}
+}
+
+func TestApiErrorUnwrap(t *testing.T) {
+	wrapped := errors.New("boom")
+	err := &apiError{err: wrapped}
+
+	if !errors.Is(err, wrapped) {
+		t.Fatal("errors.Is should see through apiError to its wrapped cause")
+	}
+}
@@ -0,0 +1,97 @@
+package switcherlabs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRUIdentityCacheGetSet(t *testing.T) {
+	c := newLRUIdentityCache(2, time.Minute)
+
+	if _, ok := c.Get("alice"); ok {
+		t.Fatal("Get on empty cache should miss")
+	}
+
+	c.Set("alice", &Identity{Identifier: "alice"})
+
+	got, ok := c.Get("alice")
+	if !ok {
+		t.Fatal("expected Get to find alice after Set")
+	}
+	if got.Identifier != "alice" {
+		t.Fatalf("got.Identifier = %q, want %q", got.Identifier, "alice")
+	}
+}
+
+func TestLRUIdentityCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newLRUIdentityCache(2, time.Minute)
+
+	c.Set("alice", &Identity{Identifier: "alice"})
+	c.Set("bob", &Identity{Identifier: "bob"})
+
+	// Touch alice so bob becomes the least recently used entry.
+	if _, ok := c.Get("alice"); !ok {
+		t.Fatal("expected alice to still be cached")
+	}
+
+	c.Set("carol", &Identity{Identifier: "carol"})
+
+	if c.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", c.Len())
+	}
+	if _, ok := c.Get("bob"); ok {
+		t.Fatal("expected bob to be evicted as least recently used")
+	}
+	if _, ok := c.Get("alice"); !ok {
+		t.Fatal("expected alice to survive eviction")
+	}
+	if _, ok := c.Get("carol"); !ok {
+		t.Fatal("expected carol to be cached")
+	}
+}
+
+func TestLRUIdentityCacheTTLExpiry(t *testing.T) {
+	c := newLRUIdentityCache(10, time.Millisecond)
+
+	c.Set("alice", &Identity{Identifier: "alice"})
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := c.Get("alice"); ok {
+		t.Fatal("expected alice to have expired")
+	}
+	if c.Len() != 0 {
+		t.Fatalf("Len() = %d, want 0 after expired entry is evicted on Get", c.Len())
+	}
+}
+
+func TestLRUIdentityCacheDelete(t *testing.T) {
+	c := newLRUIdentityCache(10, time.Minute)
+
+	c.Set("alice", &Identity{Identifier: "alice"})
+	c.Delete("alice")
+
+	if _, ok := c.Get("alice"); ok {
+		t.Fatal("expected alice to be gone after Delete")
+	}
+	if c.Len() != 0 {
+		t.Fatalf("Len() = %d, want 0", c.Len())
+	}
+}
+
+func TestLRUIdentityCacheSetUpdatesExisting(t *testing.T) {
+	c := newLRUIdentityCache(1, time.Minute)
+
+	c.Set("alice", &Identity{Identifier: "alice", Overrides: map[string]interface{}{"k": 1}})
+	c.Set("alice", &Identity{Identifier: "alice", Overrides: map[string]interface{}{"k": 2}})
+
+	got, ok := c.Get("alice")
+	if !ok {
+		t.Fatal("expected alice to still be cached after re-Set")
+	}
+	if got.Overrides["k"] != 2 {
+		t.Fatalf("got.Overrides[%q] = %v, want 2", "k", got.Overrides["k"])
+	}
+	if c.Len() != 1 {
+		t.Fatalf("Len() = %d, want 1, re-Set of an existing key should not grow the cache", c.Len())
+	}
+}
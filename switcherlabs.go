@@ -1,11 +1,18 @@
 package switcherlabs
 
 import (
+	"container/list"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
+	"io"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
+	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
@@ -27,6 +34,22 @@ const (
 
 	stateRefreshRate    = 60 * time.Second
 	identityRefreshRate = 5 * time.Second
+
+	// bootstrapLockStaleAfter is how old a BootstrapFile lock file can be
+	// before we treat it as abandoned by a crashed process and remove it.
+	bootstrapLockStaleAfter = 30 * time.Second
+
+	// bootstrapLockMaxAttempts bounds how many times we retry acquiring the
+	// BootstrapFile lock (including one retry after clearing a stale lock)
+	// before giving up.
+	bootstrapLockMaxAttempts = 5
+
+	// initialBackgroundRefreshBackoff and maxBackgroundRefreshBackoff bound
+	// the exponential backoff the background refresh loop applies after a
+	// failed refreshState call, doubling each consecutive failure and
+	// resetting on success.
+	initialBackgroundRefreshBackoff = 1 * time.Second
+	maxBackgroundRefreshBackoff     = 60 * time.Second
 )
 
 var (
@@ -84,6 +107,51 @@ type Options struct {
 
 	// APIKey is the Switcherlabs API Key used to authenticate with API.
 	APIKey string
+
+	// BootstrapFile is an optional path to a JSON file holding a previously
+	// persisted snapshot of flags and overrides (see Client.DumpState). When
+	// set, the client's first refresh seeds the client's state from this
+	// file before (or instead of, in OfflineMode) calling the API, so the
+	// client can serve flags immediately during startup or an API outage.
+	// After every successful API refresh the file is atomically rewritten
+	// with the latest state.
+	BootstrapFile string
+
+	// OfflineMode, when true, disables all outbound requests to the
+	// SwitcherLabs API. BootstrapFile must be set, and the client serves
+	// exclusively from the state loaded from it. If BootstrapFile is empty,
+	// NewClient records an error retrievable via Client.LastError instead of
+	// silently serving no flags.
+	OfflineMode bool
+
+	// BackgroundRefresh, when true, starts a goroutine in NewClient that
+	// refreshes state on a stateRefreshRate ticker (with jitter) instead of
+	// refreshing inline on the request path. On failure it retries with
+	// exponential backoff, capped at 60s and reset on success, so request-
+	// path flag calls always serve cached state instead of blocking on the
+	// API. Call Client.Close to stop the goroutine.
+	BackgroundRefresh bool
+
+	// OnRefreshError, if set, is called from the background refresh
+	// goroutine every time a refresh attempt fails. It is not called for
+	// inline (non-BackgroundRefresh) refreshes.
+	OnRefreshError func(error)
+
+	// IdentityCache, if set, overrides the default in-process LRU used to
+	// cache identities fetched via fetchIdentity (see MaxIdentities and
+	// IdentityTTL), letting callers share identities across a fleet via,
+	// for example, a Redis- or memcached-backed implementation.
+	IdentityCache IdentityCache
+
+	// MaxIdentities bounds how many identities the default IdentityCache
+	// holds at once, evicting the least recently used entry on insert past
+	// this size. Defaults to 10,000. Ignored if IdentityCache is set.
+	MaxIdentities int
+
+	// IdentityTTL is how long a fetched identity stays valid in the default
+	// IdentityCache before fetchIdentity fetches it again. Defaults to 5
+	// seconds. Ignored if IdentityCache is set.
+	IdentityTTL time.Duration
 }
 
 type FlagOptions struct {
@@ -91,16 +159,59 @@ type FlagOptions struct {
 	Identifier string
 }
 
-type Error struct {
-	Code       string `json:"code"`
-	Message    string `json:"message"`
-	StatusCode int    `json:"status_code"`
+// SwitcherError is implemented by errors returned from the SwitcherLabs API
+// and by SDK-level transport failures (network errors, malformed
+// responses). It exposes the upstream error code and HTTP status for
+// alerting and retry decisions, while still composing with errors.Is and
+// errors.As: a caller can check errors.Is(err, switcherlabs.ErrFlagNotFound)
+// for SDK-level sentinel errors, or errors.As(err, &apiErr) to pull the
+// code/status out of an API-originated failure.
+type SwitcherError interface {
+	error
+
+	// Code returns the machine-readable error code returned by the API. It
+	// is empty for errors that did not originate from an API response.
+	Code() string
+
+	// Message returns a human-readable description of the error.
+	Message() string
+
+	// HTTPStatus returns the HTTP status code of the failed response, or 0
+	// if the error did not originate from an HTTP response.
+	HTTPStatus() int
+
+	// Err returns the underlying wrapped error, if any.
+	Err() error
+}
+
+// apiError is the concrete SwitcherError implementation used for both API
+// error responses and SDK-level transport failures.
+type apiError struct {
+	code       string
+	message    string
+	httpStatus int
+	err        error
+}
+
+func (e *apiError) Code() string    { return e.code }
+func (e *apiError) Message() string { return e.message }
+func (e *apiError) HTTPStatus() int { return e.httpStatus }
+func (e *apiError) Err() error      { return e.err }
+
+func (e *apiError) Error() string {
+	switch {
+	case e.message != "":
+		return e.message
+	case e.err != nil:
+		return e.err.Error()
+	default:
+		return e.code
+	}
 }
 
-// Error serializes the error object to JSON and returns it as a string.
-func (e *Error) Error() string {
-	ret, _ := json.Marshal(e)
-	return string(ret)
+// Unwrap lets errors.Is/errors.As see through apiError to its wrapped cause.
+func (e *apiError) Unwrap() error {
+	return e.err
 }
 
 // NewClient creates a new client to interact with Switcherlabs.
@@ -113,28 +224,142 @@ func NewClient(opts *Options) *client {
 		opts.URL = String(apiURL)
 	}
 
+	identityCache := opts.IdentityCache
+	if identityCache == nil {
+		maxIdentities := opts.MaxIdentities
+		if maxIdentities == 0 {
+			maxIdentities = defaultMaxIdentities
+		}
+
+		identityTTL := opts.IdentityTTL
+		if identityTTL == 0 {
+			identityTTL = identityRefreshRate
+		}
+
+		identityCache = newLRUIdentityCache(maxIdentities, identityTTL)
+	}
+
 	c := &client{
 		HTTPClient: opts.HTTPClient,
 		URL:        *opts.URL,
 		APIKey:     opts.APIKey,
 
+		BootstrapFile:     opts.BootstrapFile,
+		OfflineMode:       opts.OfflineMode,
+		BackgroundRefresh: opts.BackgroundRefresh,
+		OnRefreshError:    opts.OnRefreshError,
+
 		flags:      make(map[string]*flag),
 		overrides:  make(map[string]*override),
-		identities: make(map[string]*identity),
+		identities: identityCache,
 
 		lastRefresh: time.Time{},
 	}
 
+	if c.OfflineMode && c.BootstrapFile == "" {
+		// Without a BootstrapFile there's no state to serve offline from, so
+		// every flag call would otherwise fail with ErrFlagNotFound forever
+		// with no indication why. Record the misconfiguration so callers can
+		// detect it via LastError instead of hitting a silent outage.
+		c.lastErr = &apiError{message: "switcherlabs: OfflineMode requires BootstrapFile to be set"}
+	}
+
+	if c.BackgroundRefresh {
+		c.refreshStop = make(chan struct{})
+		c.refreshDone = make(chan struct{})
+		go c.backgroundRefreshLoop()
+	}
+
 	return c
 }
 
+// Close stops the background refresh goroutine started when
+// Options.BackgroundRefresh is true, blocking until it has exited. It is a
+// no-op if background refresh was not enabled.
+func (s *client) Close() error {
+	if s.refreshStop == nil {
+		return nil
+	}
+
+	s.closeOnce.Do(func() {
+		close(s.refreshStop)
+	})
+	<-s.refreshDone
+
+	return nil
+}
+
+// LastError returns the error from the most recent background refresh
+// attempt, or nil if the last attempt succeeded (or background refresh is
+// not enabled). It also surfaces construction-time misconfiguration, such
+// as Options.OfflineMode set without Options.BootstrapFile.
+func (s *client) LastError() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.lastErr
+}
+
+// backgroundRefreshLoop periodically calls doRefresh on a stateRefreshRate
+// ticker (with jitter) until Close is called, backing off exponentially
+// between attempts while refreshes keep failing.
+func (s *client) backgroundRefreshLoop() {
+	defer close(s.refreshDone)
+
+	backoff := initialBackgroundRefreshBackoff
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), defaultHTTPTimeout)
+		err := s.doRefresh(ctx)
+		cancel()
+
+		s.mu.Lock()
+		s.lastErr = err
+		s.mu.Unlock()
+
+		var wait time.Duration
+		if err != nil {
+			if s.OnRefreshError != nil {
+				s.OnRefreshError(err)
+			}
+
+			wait = backoff
+			backoff *= 2
+			if backoff > maxBackgroundRefreshBackoff {
+				backoff = maxBackgroundRefreshBackoff
+			}
+		} else {
+			backoff = initialBackgroundRefreshBackoff
+			wait = stateRefreshRate + time.Duration(rand.Int63n(int64(stateRefreshRate)/10+1))
+		}
+
+		select {
+		case <-s.refreshStop:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
 // BoolFlag returns the value of the flag opts.Key for the identity with an
 // identifier of opts.Identifier
 func (s *client) BoolFlag(opts FlagOptions) (bool, error) {
-	s.refreshState()
+	return s.BoolFlagContext(context.Background(), opts)
+}
+
+// BoolFlagContext is the context-aware variant of BoolFlag. The passed
+// context is propagated to any underlying API calls made while evaluating
+// the flag, allowing callers to bound the call with a deadline or cancel it
+// early.
+func (s *client) BoolFlagContext(ctx context.Context, opts FlagOptions) (bool, error) {
+	s.refreshState(ctx)
+
+	s.mu.RLock()
+	flags, flagsByID, overrides := s.flags, s.flagsByID, s.overrides
+	s.mu.RUnlock()
 
 	// Check if the flag exists
-	f, ok := s.flags[opts.Key]
+	f, ok := flags[opts.Key]
 	if !ok {
 		return false, ErrFlagNotFound
 	}
@@ -160,7 +385,7 @@ func (s *client) BoolFlag(opts FlagOptions) (bool, error) {
 	var booleanValue bool
 
 	if opts.Identifier != "" {
-		i, err := s.fetchIdentity(opts.Identifier)
+		i, err := s.fetchIdentity(ctx, opts.Identifier)
 		if err != nil {
 			return false, nil
 		}
@@ -171,19 +396,26 @@ func (s *client) BoolFlag(opts FlagOptions) (bool, error) {
 		}
 	}
 
-	if val, ok := s.overrides[opts.Key]; ok {
+	if val, ok := overrides[opts.Key]; ok {
 		booleanValue = val.Value.(bool)
 		return booleanValue, nil
 	}
 
 	if len(f.DynamicRules) > 0 {
 		for _, rule := range f.DynamicRules {
-			expressionFlag := s.flagsByID[rule.Expression.FlagID]
+			if rule.Type == ruleKindBucket {
+				if val, ok := evaluateBucketRule(rule, opts.Identifier); ok {
+					return val.(bool), nil
+				}
+				continue
+			}
+
+			expressionFlag := flagsByID[rule.Expression.FlagID]
 			expressionFlagKey := expressionFlag.Key
 
 			switch expressionFlag.Type {
 			case typeBoolean:
-				flagValue, err := s.BoolFlag(FlagOptions{
+				flagValue, err := s.BoolFlagContext(ctx, FlagOptions{
 					Key:        expressionFlagKey,
 					Identifier: opts.Identifier,
 				})
@@ -198,7 +430,7 @@ func (s *client) BoolFlag(opts FlagOptions) (bool, error) {
 					return ruleValue, nil
 				}
 			case typeNumber:
-				flagValue, err := s.NumberFlag(FlagOptions{
+				flagValue, err := s.NumberFlagContext(ctx, FlagOptions{
 					Key:        expressionFlagKey,
 					Identifier: opts.Identifier,
 				})
@@ -213,7 +445,7 @@ func (s *client) BoolFlag(opts FlagOptions) (bool, error) {
 					return ruleValue, nil
 				}
 			case typeString:
-				flagValue, err := s.StringFlag(FlagOptions{
+				flagValue, err := s.StringFlagContext(ctx, FlagOptions{
 					Key:        expressionFlagKey,
 					Identifier: opts.Identifier,
 				})
@@ -238,10 +470,22 @@ func (s *client) BoolFlag(opts FlagOptions) (bool, error) {
 // NumberFlag returns the value of the flag opts.Key for the identity with an
 // identifier of opts.Identifier
 func (s *client) NumberFlag(opts FlagOptions) (float64, error) {
-	s.refreshState()
+	return s.NumberFlagContext(context.Background(), opts)
+}
+
+// NumberFlagContext is the context-aware variant of NumberFlag. The passed
+// context is propagated to any underlying API calls made while evaluating
+// the flag, allowing callers to bound the call with a deadline or cancel it
+// early.
+func (s *client) NumberFlagContext(ctx context.Context, opts FlagOptions) (float64, error) {
+	s.refreshState(ctx)
+
+	s.mu.RLock()
+	flags, flagsByID, overrides := s.flags, s.flagsByID, s.overrides
+	s.mu.RUnlock()
 
 	// Check if the flag exists
-	f, ok := s.flags[opts.Key]
+	f, ok := flags[opts.Key]
 	if !ok {
 		return 0, ErrFlagNotFound
 	}
@@ -267,7 +511,7 @@ func (s *client) NumberFlag(opts FlagOptions) (float64, error) {
 	var numberValue float64
 
 	if opts.Identifier != "" {
-		i, err := s.fetchIdentity(opts.Identifier)
+		i, err := s.fetchIdentity(ctx, opts.Identifier)
 		if err != nil {
 			return 0, err
 		}
@@ -278,19 +522,26 @@ func (s *client) NumberFlag(opts FlagOptions) (float64, error) {
 		}
 	}
 
-	if val, ok := s.overrides[opts.Key]; ok {
+	if val, ok := overrides[opts.Key]; ok {
 		numberValue = val.Value.(float64)
 		return numberValue, nil
 	}
 
 	if len(f.DynamicRules) > 0 {
 		for _, rule := range f.DynamicRules {
-			expressionFlag := s.flagsByID[rule.Expression.FlagID]
+			if rule.Type == ruleKindBucket {
+				if val, ok := evaluateBucketRule(rule, opts.Identifier); ok {
+					return val.(float64), nil
+				}
+				continue
+			}
+
+			expressionFlag := flagsByID[rule.Expression.FlagID]
 			expressionFlagKey := expressionFlag.Key
 
 			switch expressionFlag.Type {
 			case typeBoolean:
-				flagValue, err := s.BoolFlag(FlagOptions{
+				flagValue, err := s.BoolFlagContext(ctx, FlagOptions{
 					Key:        expressionFlagKey,
 					Identifier: opts.Identifier,
 				})
@@ -305,7 +556,7 @@ func (s *client) NumberFlag(opts FlagOptions) (float64, error) {
 					return ruleValue, nil
 				}
 			case typeNumber:
-				flagValue, err := s.NumberFlag(FlagOptions{
+				flagValue, err := s.NumberFlagContext(ctx, FlagOptions{
 					Key:        expressionFlagKey,
 					Identifier: opts.Identifier,
 				})
@@ -320,7 +571,7 @@ func (s *client) NumberFlag(opts FlagOptions) (float64, error) {
 					return ruleValue, nil
 				}
 			case typeString:
-				flagValue, err := s.StringFlag(FlagOptions{
+				flagValue, err := s.StringFlagContext(ctx, FlagOptions{
 					Key:        expressionFlagKey,
 					Identifier: opts.Identifier,
 				})
@@ -345,10 +596,22 @@ func (s *client) NumberFlag(opts FlagOptions) (float64, error) {
 // StringFlag returns the value of the flag opts.Key for the identity with an
 // identifier of opts.Identifier
 func (s *client) StringFlag(opts FlagOptions) (string, error) {
-	s.refreshState()
+	return s.StringFlagContext(context.Background(), opts)
+}
+
+// StringFlagContext is the context-aware variant of StringFlag. The passed
+// context is propagated to any underlying API calls made while evaluating
+// the flag, allowing callers to bound the call with a deadline or cancel it
+// early.
+func (s *client) StringFlagContext(ctx context.Context, opts FlagOptions) (string, error) {
+	s.refreshState(ctx)
+
+	s.mu.RLock()
+	flags, flagsByID, overrides := s.flags, s.flagsByID, s.overrides
+	s.mu.RUnlock()
 
 	// Check if the flag exists
-	f, ok := s.flags[opts.Key]
+	f, ok := flags[opts.Key]
 	if !ok {
 		return "", ErrFlagNotFound
 	}
@@ -374,7 +637,7 @@ func (s *client) StringFlag(opts FlagOptions) (string, error) {
 	var stringValue string
 
 	if opts.Identifier != "" {
-		i, err := s.fetchIdentity(opts.Identifier)
+		i, err := s.fetchIdentity(ctx, opts.Identifier)
 		if err != nil {
 			return "", err
 		}
@@ -385,19 +648,26 @@ func (s *client) StringFlag(opts FlagOptions) (string, error) {
 		}
 	}
 
-	if val, ok := s.overrides[opts.Key]; ok {
+	if val, ok := overrides[opts.Key]; ok {
 		stringValue = val.Value.(string)
 		return stringValue, nil
 	}
 
 	if len(f.DynamicRules) > 0 {
 		for _, rule := range f.DynamicRules {
-			expressionFlag := s.flagsByID[rule.Expression.FlagID]
+			if rule.Type == ruleKindBucket {
+				if val, ok := evaluateBucketRule(rule, opts.Identifier); ok {
+					return val.(string), nil
+				}
+				continue
+			}
+
+			expressionFlag := flagsByID[rule.Expression.FlagID]
 			expressionFlagKey := expressionFlag.Key
 
 			switch expressionFlag.Type {
 			case typeBoolean:
-				flagValue, err := s.BoolFlag(FlagOptions{
+				flagValue, err := s.BoolFlagContext(ctx, FlagOptions{
 					Key:        expressionFlagKey,
 					Identifier: opts.Identifier,
 				})
@@ -412,7 +682,7 @@ func (s *client) StringFlag(opts FlagOptions) (string, error) {
 					return ruleValue, nil
 				}
 			case typeNumber:
-				flagValue, err := s.NumberFlag(FlagOptions{
+				flagValue, err := s.NumberFlagContext(ctx, FlagOptions{
 					Key:        expressionFlagKey,
 					Identifier: opts.Identifier,
 				})
@@ -427,7 +697,7 @@ func (s *client) StringFlag(opts FlagOptions) (string, error) {
 					return ruleValue, nil
 				}
 			case typeString:
-				flagValue, err := s.StringFlag(FlagOptions{
+				flagValue, err := s.StringFlagContext(ctx, FlagOptions{
 					Key:        expressionFlagKey,
 					Identifier: opts.Identifier,
 				})
@@ -454,19 +724,31 @@ type client struct {
 	HTTPClient *http.Client
 	APIKey     string
 
+	BootstrapFile     string
+	OfflineMode       bool
+	BackgroundRefresh bool
+	OnRefreshError    func(error)
+
 	flags      map[string]*flag
 	flagsByID  map[string]*flag
 	overrides  map[string]*override
-	identities map[string]*identity
+	identities IdentityCache
 
 	lastRefresh time.Time
+	lastErr     error
+
+	refreshStop chan struct{}
+	refreshDone chan struct{}
+	closeOnce   sync.Once
+
+	bootstrapOnce sync.Once
 
 	mu sync.RWMutex
 }
 
 // call is the implementation for invoking requests to the SwitcherLabs API
-func (s *client) call(method, path string, v interface{}) error {
-	req, err := s.newRequest(method, path)
+func (s *client) call(ctx context.Context, method, path string, v interface{}) error {
+	req, err := s.newRequest(ctx, method, path)
 	if err != nil {
 		return err
 	}
@@ -480,14 +762,14 @@ func (s *client) call(method, path string, v interface{}) error {
 
 // newRequest is used by call to generate an http.Request. It handles encoding
 // parameters and attaches the appropriate headers.
-func (s *client) newRequest(method, path string) (*http.Request, error) {
+func (s *client) newRequest(ctx context.Context, method, path string) (*http.Request, error) {
 	if !strings.HasPrefix(path, "/") {
 		path = "/" + path
 	}
 
 	path = s.URL + path
 
-	req, err := http.NewRequest(method, path, nil)
+	req, err := http.NewRequestWithContext(ctx, method, path, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -503,56 +785,113 @@ func (s *client) newRequest(method, path string) (*http.Request, error) {
 // the backend's HTTP client to execute the request and unmarshals the response
 // into v. It also handles unmarshaling errors returned by the API.
 func (s *client) do(req *http.Request, v interface{}) error {
-	var res *http.Response
-	var err error
-	var resBody []byte
-
-	res, err = s.HTTPClient.Do(req)
+	res, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return &apiError{err: fmt.Errorf("switcherlabs: request failed: %w", err)}
+	}
 
-	if err == nil {
-		resBody, err = ioutil.ReadAll(res.Body)
-		res.Body.Close()
+	resBody, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return &apiError{
+			httpStatus: res.StatusCode,
+			err:        fmt.Errorf("switcherlabs: could not read response body: %w", err),
+		}
 	}
 
 	if res.StatusCode >= 400 {
-		err = s.responseToError(res, resBody)
+		return s.responseToError(res, resBody)
 	}
 
-	if err != nil {
-		return err
+	if err := json.Unmarshal(resBody, v); err != nil {
+		return &apiError{
+			httpStatus: res.StatusCode,
+			err:        fmt.Errorf("switcherlabs: could not parse response: %w", err),
+		}
 	}
 
-	err = json.Unmarshal(resBody, v)
-
-	return err
+	return nil
 }
 
-// responseToError converts an http response to an Error.
+// responseToError converts a failed http response into a SwitcherError.
 func (s *client) responseToError(res *http.Response, resBody []byte) error {
 	var raw rawError
 	if err := json.Unmarshal(resBody, &raw); err != nil {
-		return err
+		return &apiError{
+			httpStatus: res.StatusCode,
+			err:        fmt.Errorf("switcherlabs: could not parse error response: %w", err),
+		}
 	}
 
-	return raw.Error
+	apiErr := &apiError{httpStatus: res.StatusCode}
+	if raw.Error != nil {
+		apiErr.code = raw.Error.Code
+		apiErr.message = raw.Error.Message
+	} else {
+		// The body was valid JSON but didn't carry the expected error shape
+		// (e.g. "{}", or a proxy/load-balancer error page). Fall back to a
+		// message derived from the status code so Error() is never blank.
+		apiErr.message = fmt.Sprintf("switcherlabs: request failed with status %d", res.StatusCode)
+	}
+
+	return apiErr
+}
+
+// stateSnapshot is the wire and on-disk representation of a client's flags
+// and overrides. It is used both for the /sdk/initialize API response and
+// for Options.BootstrapFile (via loadBootstrapFile/writeBootstrapFile and
+// Client.DumpState).
+type stateSnapshot struct {
+	Flags     []*flag     `json:"flags"`
+	Overrides []*override `json:"overrides"`
+}
+
+// refreshState is called inline from the request path (BoolFlagContext,
+// NumberFlagContext, StringFlagContext). When Options.BackgroundRefresh is
+// enabled, doRefresh instead runs exclusively on the background refresh
+// goroutine, so this is a no-op and request-path calls always serve
+// whatever state that goroutine last fetched.
+func (s *client) refreshState(ctx context.Context) error {
+	if s.BackgroundRefresh {
+		return nil
+	}
+
+	return s.doRefresh(ctx)
 }
 
-func (s *client) refreshState() error {
+// doRefresh performs the actual bootstrap-load-then-fetch-from-API sequence
+// described on Options.BootstrapFile, for both refreshState and the
+// background refresh goroutine.
+func (s *client) doRefresh(ctx context.Context) error {
 	now := time.Now()
 
-	// State is still valid so short-circuit and return
-	if s.lastRefresh.Add(stateRefreshRate).After(now) {
+	s.mu.RLock()
+	lastRefresh := s.lastRefresh
+	s.mu.RUnlock()
+
+	if s.BootstrapFile != "" {
+		// Best-effort: seed state from the bootstrap file so the client can
+		// serve flags immediately, even if the network request below is slow
+		// or the API is unreachable. A missing or corrupt file is not fatal
+		// here -- we still fall through to the network refresh below.
+		s.bootstrapOnce.Do(func() { _ = s.loadBootstrapFile() })
+	}
+
+	if s.OfflineMode {
+		if s.BootstrapFile == "" {
+			return &apiError{message: "switcherlabs: OfflineMode requires BootstrapFile to be set"}
+		}
 		return nil
 	}
 
-	type response struct {
-		Flags     []*flag     `json:"flags"`
-		Overrides []*override `json:"overrides"`
+	// State is still valid so short-circuit and return
+	if lastRefresh.Add(stateRefreshRate).After(now) {
+		return nil
 	}
 
-	resp := &response{}
+	resp := &stateSnapshot{}
 
-	err := s.call(http.MethodGet, "/sdk/initialize", resp)
+	err := s.call(ctx, http.MethodGet, "/sdk/initialize", resp)
 	if err != nil {
 		return err
 	}
@@ -569,6 +908,50 @@ func (s *client) refreshState() error {
 		overrides[o.Key] = o
 	}
 
+	s.mu.Lock()
+	s.flags = flags
+	s.flagsByID = flagsByID
+	s.overrides = overrides
+	s.lastRefresh = now
+	s.mu.Unlock()
+
+	// writeBootstrapFile does its own file-lock retry loop and a temp-file
+	// write/rename, which can be slow -- do it after releasing s.mu so it
+	// doesn't block concurrent flag reads.
+	if s.BootstrapFile != "" {
+		if err := s.writeBootstrapFile(resp); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadBootstrapFile reads Options.BootstrapFile and seeds the client's flags
+// and overrides from it.
+func (s *client) loadBootstrapFile() error {
+	data, err := ioutil.ReadFile(s.BootstrapFile)
+	if err != nil {
+		return err
+	}
+
+	var snapshot stateSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return err
+	}
+
+	flags := make(map[string]*flag, len(snapshot.Flags))
+	flagsByID := make(map[string]*flag, len(snapshot.Flags))
+	for _, f := range snapshot.Flags {
+		flags[f.Key] = f
+		flagsByID[f.ID] = f
+	}
+
+	overrides := make(map[string]*override, len(snapshot.Overrides))
+	for _, o := range snapshot.Overrides {
+		overrides[o.Key] = o
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -576,56 +959,195 @@ func (s *client) refreshState() error {
 	s.flagsByID = flagsByID
 	s.overrides = overrides
 
-	for identifier, i := range s.identities {
-		if i.isStale() {
-			delete(s.identities, identifier)
-		}
+	return nil
+}
+
+// writeBootstrapFile atomically rewrites Options.BootstrapFile with
+// snapshot: it writes to a temp file in the same directory and renames it
+// into place, so readers (including other processes sharing the file) never
+// observe a torn write. An advisory lock file guards the write itself
+// against concurrent writers; a lock left behind by a process that crashed
+// mid-write is cleared after bootstrapLockStaleAfter.
+func (s *client) writeBootstrapFile(snapshot *stateSnapshot) error {
+	unlock, err := s.lockBootstrapFile()
+	if err != nil {
+		return err
 	}
+	defer unlock()
 
-	s.lastRefresh = now
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
 
-	return nil
+	dir := filepath.Dir(s.BootstrapFile)
+
+	tmp, err := ioutil.TempFile(dir, ".switcherlabs-bootstrap-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, s.BootstrapFile)
 }
 
-func (s *client) fetchIdentity(identifier string) (*identity, error) {
+// lockBootstrapFile acquires the advisory lock file alongside
+// Options.BootstrapFile, returning a function that releases it. It retries
+// up to bootstrapLockMaxAttempts times, clearing the lock file if it looks
+// abandoned by a crashed writer.
+func (s *client) lockBootstrapFile() (func(), error) {
+	lockPath := s.BootstrapFile + ".lock"
+
+	var lastErr error
+	for attempt := 0; attempt < bootstrapLockMaxAttempts; attempt++ {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			fmt.Fprintf(f, "%d", os.Getpid())
+			f.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		lastErr = err
+
+		if info, statErr := os.Stat(lockPath); statErr == nil {
+			if time.Since(info.ModTime()) > bootstrapLockStaleAfter {
+				os.Remove(lockPath)
+				continue
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return nil, fmt.Errorf("switcherlabs: could not acquire lock on %s: %w", lockPath, lastErr)
+}
+
+// DumpState writes the client's current flags and overrides to w as JSON, in
+// the same shape Options.BootstrapFile expects. This is useful for exporting
+// state in CI, or for seeding a bootstrap file for another environment.
+func (s *client) DumpState(w io.Writer) error {
 	s.mu.RLock()
-	if i, ok := s.identities[identifier]; ok && !i.isStale() {
-		s.mu.RUnlock()
+	defer s.mu.RUnlock()
+
+	snapshot := &stateSnapshot{
+		Flags:     make([]*flag, 0, len(s.flags)),
+		Overrides: make([]*override, 0, len(s.overrides)),
+	}
+	for _, f := range s.flags {
+		snapshot.Flags = append(snapshot.Flags, f)
+	}
+	for _, o := range s.overrides {
+		snapshot.Overrides = append(snapshot.Overrides, o)
+	}
+
+	return json.NewEncoder(w).Encode(snapshot)
+}
+
+func (s *client) fetchIdentity(ctx context.Context, identifier string) (*Identity, error) {
+	if i, ok := s.identities.Get(identifier); ok {
 		return i, nil
 	}
-	s.mu.RUnlock()
 
 	path := fmt.Sprintf("sdk/identities/%s", identifier)
 
-	newIdentity := &identity{}
+	newIdentity := &Identity{}
 
-	err := s.call(http.MethodGet, path, newIdentity)
+	err := s.call(ctx, http.MethodGet, path, newIdentity)
 	if err != nil {
 		return nil, err
 	}
 
-	newIdentity.fetchedAt = time.Now()
-
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.identities[newIdentity.Identifier] = newIdentity
+	s.identities.Set(newIdentity.Identifier, newIdentity)
 
 	return newIdentity, nil
 }
 
 type flag struct {
-	ID           string      `json:"id"`
-	Key          string      `json:"key"`
-	Type         string      `json:"type"`
-	Value        interface{} `json:"value"`
-	DynamicRules []struct {
-		Expression struct {
-			FlagID string      `json:"flag_id"`
-			Op     string      `json:"op"`
-			Value  interface{} `json:"value"`
+	ID           string         `json:"id"`
+	Key          string         `json:"key"`
+	Type         string         `json:"type"`
+	Value        interface{}    `json:"value"`
+	DynamicRules []*dynamicRule `json:"dynamic_rules"`
+}
+
+// ruleKind discriminates the shape of a dynamicRule. Rules with no Type are
+// treated as ruleKindExpression, for backward compatibility with data
+// predating the bucket rule kind.
+type ruleKind string
+
+const (
+	ruleKindExpression ruleKind = "expression"
+	ruleKindBucket     ruleKind = "bucket"
+)
+
+// bucketRange is one [From, To) basis-point range of a ruleKindBucket rule,
+// bounded in [0, bucketRangeSize).
+type bucketRange struct {
+	From  int         `json:"from"`
+	To    int         `json:"to"`
+	Value interface{} `json:"value"`
+}
+
+// dynamicRule is one entry of flag.DynamicRules. An expression rule
+// compares another flag's value (Expression) against Expression.Value and
+// returns Value on match. A bucket rule hashes the evaluating identifier
+// into a stable bucket and returns the Value of whichever Ranges entry it
+// falls into.
+type dynamicRule struct {
+	Type ruleKind `json:"type"`
+
+	Expression struct {
+		FlagID string      `json:"flag_id"`
+		Op     string      `json:"op"`
+		Value  interface{} `json:"value"`
+	} `json:"expression"`
+	Value interface{} `json:"value"`
+
+	Salt   string        `json:"salt"`
+	Ranges []bucketRange `json:"ranges"`
+}
+
+// bucketRangeSize is the width of the basis-point space bucket rules hash
+// identifiers into, i.e. bucket rules partition [0, bucketRangeSize).
+const bucketRangeSize = 10000
+
+// evaluateBucketRule returns the Value of the bucketRange that identifier
+// falls into for rule, and true. It returns false (meaning: fall through to
+// the next rule) if identifier is empty or no range in rule.Ranges matches.
+func evaluateBucketRule(rule *dynamicRule, identifier string) (interface{}, bool) {
+	if identifier == "" {
+		return nil, false
+	}
+
+	bucket := bucketOf(identifier, rule.Salt)
+
+	for _, r := range rule.Ranges {
+		if bucket >= r.From && bucket < r.To {
+			return r.Value, true
 		}
-		Value interface{} `json:"value"`
-	} `json:"dynamic_rules"`
+	}
+
+	return nil, false
+}
+
+// bucketOf hashes identifier and salt with FNV-1a into a bucket in
+// [0, bucketRangeSize). The same identifier and salt always hash to the
+// same bucket, across processes and SDK versions.
+func bucketOf(identifier, salt string) int {
+	h := fnv.New32a()
+	io.WriteString(h, identifier)
+	io.WriteString(h, salt)
+
+	return int(h.Sum32() % bucketRangeSize)
 }
 
 type override struct {
@@ -634,22 +1156,142 @@ type override struct {
 	Value interface{} `json:"value"`
 }
 
-type identity struct {
+// Identity is a single identifier's fetched overrides, as returned by
+// /sdk/identities/{identifier} and cached by the client's IdentityCache.
+type Identity struct {
 	ID         string                 `json:"id"`
 	Identifier string                 `json:"identifier"`
 	Overrides  map[string]interface{} `json:"overrides"`
+}
+
+// IdentityCache is the pluggable cache fetchIdentity reads and writes
+// fetched identities through. The default, used when Options.IdentityCache
+// is unset, is an in-process LRU bounded by Options.MaxIdentities with
+// per-entry TTL of Options.IdentityTTL (see newLRUIdentityCache). Supply
+// your own implementation -- e.g. backed by Redis or memcached -- to share
+// identities across a fleet instead.
+type IdentityCache interface {
+	// Get returns the cached identity for identifier, and whether it was
+	// found (and not expired).
+	Get(identifier string) (*Identity, bool)
+
+	// Set stores i under identifier, evicting another entry first if doing
+	// so would exceed the cache's size bound.
+	Set(identifier string, i *Identity)
+
+	// Delete removes identifier from the cache, if present.
+	Delete(identifier string)
+
+	// Len returns the number of entries currently in the cache.
+	Len() int
+}
+
+// defaultMaxIdentities is the default Options.MaxIdentities used by the
+// default LRU IdentityCache.
+const defaultMaxIdentities = 10_000
+
+// lruIdentityCacheEntry is the value stored in lruIdentityCache.ll.
+type lruIdentityCacheEntry struct {
+	identifier string
+	value      *Identity
+	expiresAt  time.Time
+}
+
+// lruIdentityCache is the default IdentityCache: an in-process LRU bounded
+// by capacity, with entries expiring ttl after they're set. It evicts the
+// least recently used entry on insert once capacity is reached, so a burst
+// of unique identifiers can't grow the cache unbounded between evictions.
+type lruIdentityCache struct {
+	capacity int
+	ttl      time.Duration
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+func newLRUIdentityCache(capacity int, ttl time.Duration) *lruIdentityCache {
+	return &lruIdentityCache{
+		capacity: capacity,
+		ttl:      ttl,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (c *lruIdentityCache) Get(identifier string) (*Identity, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[identifier]
+	if !ok {
+		return nil, false
+	}
+
+	entry := el.Value.(*lruIdentityCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.removeElement(el)
+		return nil, false
+	}
+
+	c.ll.MoveToFront(el)
+
+	return entry.value, true
+}
+
+func (c *lruIdentityCache) Set(identifier string, i *Identity) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[identifier]; ok {
+		c.ll.MoveToFront(el)
+		entry := el.Value.(*lruIdentityCacheEntry)
+		entry.value = i
+		entry.expiresAt = time.Now().Add(c.ttl)
+		return
+	}
+
+	el := c.ll.PushFront(&lruIdentityCacheEntry{
+		identifier: identifier,
+		value:      i,
+		expiresAt:  time.Now().Add(c.ttl),
+	})
+	c.items[identifier] = el
+
+	for c.capacity > 0 && c.ll.Len() > c.capacity {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+func (c *lruIdentityCache) Delete(identifier string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[identifier]; ok {
+		c.removeElement(el)
+	}
+}
+
+func (c *lruIdentityCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	fetchedAt time.Time
+	return c.ll.Len()
 }
 
-func (i *identity) isStale() bool {
-	return i.fetchedAt.Add(identityRefreshRate).Before(time.Now())
+// removeElement removes el from both c.ll and c.items. Callers must hold c.mu.
+func (c *lruIdentityCache) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*lruIdentityCacheEntry).identifier)
 }
 
 // rawError deserializes the outer JSON object returned in an error response
 // from the API.
 type rawError struct {
-	Error *Error `json:"error,omitempty"`
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
 }
 
 func String(s string) *string {